@@ -0,0 +1,123 @@
+package gofpdi
+
+// ImportOptions controls which interactive objects ImportPageWithOptions
+// preserves alongside the page's form XObject. The plain form-XObject
+// import used by ImportPage drops /Annots entirely, which loses hyperlinks
+// and bookmarks; ImportPageWithOptions lets a caller opt back into them.
+type ImportOptions struct {
+	// IncludeLinkAnnotations preserves /Link annotations (URI and GoTo
+	// destinations).
+	IncludeLinkAnnotations bool
+
+	// IncludeAllAnnotations preserves every annotation subtype on the
+	// page, not just links.
+	IncludeAllAnnotations bool
+
+	// IncludeOutlines preserves the source document's outline (bookmark)
+	// tree.
+	IncludeOutlines bool
+}
+
+// ImportedAnnotation is an annotation carried over from a source page by
+// ImportPageWithOptions. X, Y, W and H describe the annotation's rect in
+// the box's user space, i.e. the same space as the x/y/w/h UseTemplate
+// takes, so callers can transform an annotation's position through the
+// same math they use to position the template itself.
+type ImportedAnnotation struct {
+	Subtype string // e.g. "/Link", "/Text"
+	X       float64
+	Y       float64
+	W       float64
+	H       float64
+
+	// URI is set for link annotations with a URI action.
+	URI string
+
+	// GoToPage is the 1-based destination page number for link
+	// annotations with a GoTo action targeting another page in the
+	// source document; 0 if not applicable.
+	GoToPage int
+}
+
+// ImportedOutline is one entry of the source document's outline (bookmark)
+// tree, preserved by ImportPageWithOptions when ImportOptions.IncludeOutlines
+// is set.
+type ImportedOutline struct {
+	Title string
+	Page  int
+	X     float64
+	Y     float64
+}
+
+// ImportPageWithOptions is ImportPage with optional preservation of
+// annotations and/or outlines from the source page. It returns only the
+// template id; the preserved annotations and outlines are read back with
+// GetImportedAnnotations and GetImportedOutlines. gofpdi does not write them
+// into any output page itself; their rects are in the same space as the
+// x/y/w/h passed to UseTemplate.
+func (importer *Importer) ImportPageWithOptions(pageno int, box string, opts ImportOptions) (int, error) {
+	importer.mu.RLock()
+	sourceKey := importer.sourceFile
+	importer.mu.RUnlock()
+
+	tplN, err := importer.importPage(sourceKey, pageno, box)
+	if err != nil {
+		return 0, err
+	}
+	reader := importer.GetReaderForFile(sourceKey)
+
+	if opts.IncludeLinkAnnotations || opts.IncludeAllAnnotations {
+		annots, err := reader.getPageAnnotations(pageno, box, opts.IncludeAllAnnotations)
+		if err != nil {
+			return tplN, err
+		}
+
+		importer.mu.Lock()
+		importer.importedAnnotations[tplN] = annots
+		importer.mu.Unlock()
+	}
+
+	if opts.IncludeOutlines {
+		outlines, err := reader.getOutlines()
+		if err != nil {
+			return tplN, err
+		}
+
+		importer.mu.Lock()
+		importer.importedOutlines[sourceKey] = outlines
+		importer.mu.Unlock()
+	}
+
+	return tplN, nil
+}
+
+// GetImportedAnnotations returns the annotations preserved for tplid by an
+// earlier ImportPageWithOptions call, or nil if none were requested.
+func (importer *Importer) GetImportedAnnotations(tplid int) []ImportedAnnotation {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.importedAnnotations[tplid]
+}
+
+// GetImportedOutlines returns the current source file's outline tree
+// preserved by an earlier ImportPageWithOptions call that set
+// ImportOptions.IncludeOutlines, or nil if none was requested. Like
+// GetReader/GetWriter, it acts on whichever source file SetSourceFile(...)
+// last selected; use GetImportedOutlinesForFile for a specific source file
+// regardless of which one is current.
+func (importer *Importer) GetImportedOutlines() []ImportedOutline {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.importedOutlines[importer.sourceFile]
+}
+
+// GetImportedOutlinesForFile returns the outline tree preserved for a
+// specific source file by an earlier ImportPageWithOptions call, regardless
+// of which source file is currently selected. This is the form multi-source
+// callers want, since GetImportedOutlines only ever sees the current source
+// file's outlines.
+func (importer *Importer) GetImportedOutlinesForFile(sourceFile string) []ImportedOutline {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.importedOutlines[sourceFile]
+}
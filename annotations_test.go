@@ -0,0 +1,172 @@
+package gofpdi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildOutlinedPDF writes a minimal one-page PDF with a /Link annotation
+// (a URI action) and a one-entry outline (bookmark) tree pointing at the
+// page, using the given title so two fixtures can be told apart. If
+// cropBox is non-empty, it's added as the page's /CropBox (anchored away
+// from the /MediaBox origin, to exercise box-relative annotation rects).
+func buildOutlinedPDF(t *testing.T, title, uri string, cropBox ...float64) string {
+	t.Helper()
+
+	const (
+		objCatalog  = 1
+		objPages    = 2
+		objPage     = 3
+		objContent  = 4
+		objOutlines = 5
+		objOutline1 = 6
+	)
+
+	var buf []byte
+	offsets := make(map[int]int64)
+	writeObj := func(num int, dict string, stream []byte) {
+		offsets[num] = int64(len(buf))
+		buf = append(buf, []byte(fmt.Sprintf("%d 0 obj\n%s", num, dict))...)
+		if stream != nil {
+			buf = append(buf, []byte("\nstream\n")...)
+			buf = append(buf, stream...)
+			buf = append(buf, []byte("\nendstream")...)
+		}
+		buf = append(buf, []byte("\nendobj\n")...)
+	}
+
+	buf = append(buf, []byte("%PDF-1.4\n")...)
+
+	cropBoxEntry := ""
+	if len(cropBox) == 4 {
+		cropBoxEntry = fmt.Sprintf(" /CropBox [%g %g %g %g]", cropBox[0], cropBox[1], cropBox[2], cropBox[3])
+	}
+
+	writeObj(objCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /Outlines %d 0 R >>", objPages, objOutlines), nil)
+	writeObj(objPages, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] /Count 1 >>", objPage), nil)
+	writeObj(objPage, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 200 300]%s /Resources << >> /Contents %d 0 R "+
+			"/Annots [<< /Type /Annot /Subtype /Link /Rect [10 20 50 60] /A << /Type /Action /S /URI /URI (%s) >> >>] >>",
+		objPages, cropBoxEntry, objContent, uri), nil)
+	content := []byte("BT (hi) Tj ET")
+	writeObj(objContent, fmt.Sprintf("<< /Length %d >>", len(content)), content)
+	writeObj(objOutlines, fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count 1 >>", objOutline1, objOutline1), nil)
+	writeObj(objOutline1, fmt.Sprintf("<< /Title (%s) /Parent %d 0 R /Dest [%d 0 R /XYZ 0 300 0] >>", title, objOutlines, objPage), nil)
+
+	lastObj := objOutline1
+	xrefOffset := len(buf)
+	buf = append(buf, []byte(fmt.Sprintf("xref\n0 %d\n", lastObj+1))...)
+	buf = append(buf, []byte("0000000000 65535 f \n")...)
+	for n := 1; n <= lastObj; n++ {
+		buf = append(buf, []byte(fmt.Sprintf("%010d 00000 n \n", offsets[n]))...)
+	}
+	buf = append(buf, []byte(fmt.Sprintf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF", lastObj+1, objCatalog, xrefOffset))...)
+
+	path := filepath.Join(t.TempDir(), title+".pdf")
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportPageWithOptionsAnnotationsAndOutlines(t *testing.T) {
+	path := buildOutlinedPDF(t, "Chapter One", "https://example.com/one")
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tplN, err := importer.ImportPageWithOptions(1, "/MediaBox", ImportOptions{
+		IncludeLinkAnnotations: true,
+		IncludeOutlines:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annots := importer.GetImportedAnnotations(tplN)
+	if len(annots) != 1 {
+		t.Fatalf("GetImportedAnnotations() = %+v, want 1 link annotation", annots)
+	}
+	if annots[0].URI != "https://example.com/one" {
+		t.Fatalf("annotation URI = %q, want https://example.com/one", annots[0].URI)
+	}
+
+	outlines := importer.GetImportedOutlines()
+	if len(outlines) != 1 || outlines[0].Title != "Chapter One" {
+		t.Fatalf("GetImportedOutlines() = %+v, want one entry titled Chapter One", outlines)
+	}
+}
+
+// TestImportedAnnotationRectMatchesBoxOrigin imports via a /CropBox that
+// isn't anchored at the page's /MediaBox origin, and checks the returned
+// annotation rect is translated into that box's user space - the same
+// space PdfWriter.emitFormXObject's Matrix puts the Form XObject's content
+// in - rather than left in the page's raw /MediaBox-relative coordinates.
+func TestImportedAnnotationRectMatchesBoxOrigin(t *testing.T) {
+	path := buildOutlinedPDF(t, "Cropped", "https://example.com/cropped", 5, 15, 200, 300)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tplN, err := importer.ImportPageWithOptions(1, "/CropBox", ImportOptions{IncludeLinkAnnotations: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annots := importer.GetImportedAnnotations(tplN)
+	if len(annots) != 1 {
+		t.Fatalf("GetImportedAnnotations() = %+v, want 1 link annotation", annots)
+	}
+
+	// /Rect is [10 20 50 60]; the CropBox origin is (5, 15), so the rect in
+	// CropBox user space - the space emitFormXObject's Matrix [1 0 0 1 -5
+	// -15] puts the template's content in - is X=5, Y=5.
+	const wantX, wantY = 5.0, 5.0
+	if annots[0].X != wantX || annots[0].Y != wantY {
+		t.Fatalf("annotation rect = (X=%v, Y=%v), want (X=%v, Y=%v) relative to the imported box's origin",
+			annots[0].X, annots[0].Y, wantX, wantY)
+	}
+}
+
+func TestImportedOutlinesDoNotClobberAcrossSourceFiles(t *testing.T) {
+	pathA := buildOutlinedPDF(t, "From A", "https://example.com/a")
+	pathB := buildOutlinedPDF(t, "From B", "https://example.com/b")
+
+	importer := NewImporter()
+
+	if err := importer.SetSourceFile(pathA); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.ImportPageWithOptions(1, "/MediaBox", ImportOptions{IncludeOutlines: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := importer.SetSourceFile(pathB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.ImportPageWithOptions(1, "/MediaBox", ImportOptions{IncludeOutlines: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Importing B's outlines must not have clobbered A's.
+	outlinesA := importer.GetImportedOutlinesForFile(pathA)
+	outlinesB := importer.GetImportedOutlinesForFile(pathB)
+	if len(outlinesA) != 1 || outlinesA[0].Title != "From A" {
+		t.Fatalf("GetImportedOutlinesForFile(A) = %+v, want one entry titled 'From A'", outlinesA)
+	}
+	if len(outlinesB) != 1 || outlinesB[0].Title != "From B" {
+		t.Fatalf("GetImportedOutlinesForFile(B) = %+v, want one entry titled 'From B'", outlinesB)
+	}
+
+	// GetImportedOutlines (no-arg) tracks whichever source file is current,
+	// matching GetReader/GetWriter's existing convention.
+	if got := importer.GetImportedOutlines(); len(got) != 1 || got[0].Title != "From B" {
+		t.Fatalf("GetImportedOutlines() (current source = B) = %+v, want one entry titled 'From B'", got)
+	}
+}
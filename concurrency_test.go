@@ -0,0 +1,93 @@
+package gofpdi
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentImportFromDifferentFiles exercises the scenario chunk0-4
+// was meant to unblock: a server importing pages from many source PDFs in
+// parallel. Run with -race; it mainly exists to give the race detector
+// something to check against ImportPageFromFile running concurrently across
+// distinct source files. PutFormXobjects/GetImportedObjects are then called
+// for each file's writer one after another, once all imports are done.
+func TestConcurrentImportFromDifferentFiles(t *testing.T) {
+	const numFiles = 8
+	paths := make([]string, numFiles)
+	for i := range paths {
+		paths[i] = buildTestPDF(t, []testPageSpec{{content: fmt.Sprintf("BT (file %d) Tj ET", i)}}, nil)
+	}
+
+	importer := NewImporter()
+
+	var wg sync.WaitGroup
+	tplNs := make([]int, numFiles)
+	errs := make([]error, numFiles)
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			tplNs[i], errs[i] = importer.ImportPageFromFile(path, 1, "/MediaBox")
+		}(i, path)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, numFiles)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("ImportPageFromFile(%d) failed: %v", i, err)
+		}
+		if seen[tplNs[i]] {
+			t.Fatalf("template id %d assigned to more than one file", tplNs[i])
+		}
+		seen[tplNs[i]] = true
+	}
+
+	totalObjs := 0
+	for _, path := range paths {
+		writer := importer.GetWriterForFile(path)
+		reader := importer.GetReaderForFile(path)
+		if _, err := writer.PutFormXobjects(reader); err != nil {
+			t.Fatal(err)
+		}
+		totalObjs += len(writer.GetImportedObjects())
+	}
+	if totalObjs != numFiles {
+		t.Fatalf("emitted %d objects across all files' writers, want %d", totalObjs, numFiles)
+	}
+}
+
+// TestConcurrentImportSamePageDedupes checks that racing on the exact same
+// (source file, page) pair - the one case importPage can't parallelize
+// away - still converges on a single template rather than registering two.
+func TestConcurrentImportSamePageDedupes(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (shared) Tj ET"}}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 16
+	var wg sync.WaitGroup
+	tplNs := make([]int, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tplNs[i], errs[i] = importer.ImportPage(1, "/MediaBox")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("ImportPage() worker %d failed: %v", i, err)
+		}
+		if tplNs[i] != tplNs[0] {
+			t.Fatalf("ImportPage() returned inconsistent template ids for the same page: %v", tplNs)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package gofpdi
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestImportPagesDedupesSharedStreamResources checks what ImportPages'
+// updated doc comment actually promises: a *stream* resource (here, an
+// image XObject) referenced by more than one imported page is copied into
+// the output exactly once, because that dedup comes from PdfWriter's
+// per-reference cache rather than from ImportPages itself.
+func TestImportPagesDedupesSharedStreamResources(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{
+		{content: "BT (page one) Tj ET", imageRef: true},
+		{content: "BT (page two) Tj ET", imageRef: true},
+	}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tplNs, err := importer.ImportPages([]int{1, 2}, "/MediaBox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tplNs) != 2 {
+		t.Fatalf("ImportPages() returned %d templates, want 2", len(tplNs))
+	}
+
+	if _, err := importer.PutFormXobjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	imageObjects := 0
+	for _, body := range importer.GetImportedObjects() {
+		if bytes.Contains([]byte(body), []byte("/Subtype /Image")) || bytes.Contains([]byte(body), []byte("/Subtype/Image")) {
+			imageObjects++
+		}
+	}
+	if imageObjects != 1 {
+		t.Fatalf("shared image object emitted %d times via ImportPages, want 1", imageObjects)
+	}
+}
+
+// TestImportPagesReturnsCachedResultForAlreadyImportedPage checks the one
+// piece of the old doc comment that was accurate: a page already imported
+// (by ImportPage or an earlier ImportPages call) comes back from cache
+// rather than being imported a second time.
+func TestImportPagesReturnsCachedResultForAlreadyImportedPage(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{
+		{content: "BT (page one) Tj ET"},
+		{content: "BT (page two) Tj ET"},
+	}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	firstTplN, err := importer.ImportPage(1, "/MediaBox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tplNs, err := importer.ImportPages([]int{1, 2}, "/MediaBox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tplNs[0] != firstTplN {
+		t.Fatalf("ImportPages() re-imported page 1 as template %d, want cached template %d", tplNs[0], firstTplN)
+	}
+	if tplNs[1] == tplNs[0] {
+		t.Fatalf("ImportPages() assigned the same template id to two different pages")
+	}
+}
@@ -1,12 +1,19 @@
 package gofpdi
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // The Importer class to be used by a pdf generation library
 type Importer struct {
+	// mu guards every field below so an Importer can be shared by
+	// goroutines importing from different source files concurrently.
+	mu sync.RWMutex
+
 	sourceFile    string
 	readers       map[string]*PdfReader
 	writers       map[string]*PdfWriter
@@ -14,6 +21,20 @@ type Importer struct {
 	tplN          int
 	writer        *PdfWriter
 	importedPages map[string]int
+
+	// decodedObjects and decodedHashPos hold the hashed object bytes and
+	// hash positions restored by DecodeTemplates for templates that have
+	// no live Writer backing them.
+	decodedObjects map[string][]byte
+	decodedHashPos map[string]map[int]string
+
+	// importedAnnotations and importedOutlines hold the interactive
+	// objects collected by ImportPageWithOptions. importedOutlines is
+	// keyed by source file, since two source documents may each have
+	// their own outline tree and ImportPageWithOptions can be called for
+	// more than one source file against the same Importer.
+	importedAnnotations map[int][]ImportedAnnotation
+	importedOutlines    map[string][]ImportedOutline
 }
 
 // TplInfo -
@@ -21,20 +42,48 @@ type TplInfo struct {
 	SourceFile string
 	Writer     *PdfWriter
 	TemplateId int
+
+	// PageNo and Box record the source page and box this template was
+	// imported from, and W/H the box dimensions (in points). They are
+	// populated by ImportPage and are used to recreate the template after
+	// a round trip through EncodeTemplates/DecodeTemplates.
+	PageNo int
+	Box    string
+	W      float64
+	H      float64
 }
 
 // GetReader -
 func (importer *Importer) GetReader() *PdfReader {
-	return importer.GetReaderForFile(importer.sourceFile)
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.readerForFile(importer.sourceFile)
 }
 
 // GetWriter -
 func (importer *Importer) GetWriter() *PdfWriter {
-	return importer.GetWriterForFile(importer.sourceFile)
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.writerForFile(importer.sourceFile)
 }
 
 // GetReaderForFile -
 func (importer *Importer) GetReaderForFile(file string) *PdfReader {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.readerForFile(file)
+}
+
+// GetWriterForFile -
+func (importer *Importer) GetWriterForFile(file string) *PdfWriter {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	return importer.writerForFile(file)
+}
+
+// readerForFile and writerForFile are the unlocked lookups used internally
+// by callers that already hold importer.mu.
+func (importer *Importer) readerForFile(file string) *PdfReader {
 	if _, ok := importer.readers[file]; ok {
 		return importer.readers[file]
 	}
@@ -42,8 +91,7 @@ func (importer *Importer) GetReaderForFile(file string) *PdfReader {
 	return nil
 }
 
-// GetWriterForFile -
-func (importer *Importer) GetWriterForFile(file string) *PdfWriter {
+func (importer *Importer) writerForFile(file string) *PdfWriter {
 	if _, ok := importer.writers[file]; ok {
 		return importer.writers[file]
 	}
@@ -65,49 +113,123 @@ func (importer *Importer) init() {
 	importer.tplMap = make(map[int]*TplInfo, 0)
 	importer.writer, _ = NewPdfWriter("")
 	importer.importedPages = make(map[string]int, 0)
+	importer.decodedObjects = make(map[string][]byte, 0)
+	importer.decodedHashPos = make(map[string]map[int]string, 0)
+	importer.importedAnnotations = make(map[int][]ImportedAnnotation, 0)
+	importer.importedOutlines = make(map[string][]ImportedOutline, 0)
 }
 
 // SetSourceFile -
 func (importer *Importer) SetSourceFile(f string) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	importer.sourceFile = f
+	return importer.ensureReaderWriter(f, func() (*PdfReader, error) {
+		return NewPdfReader(f)
+	})
+}
+
+// SetSourceFileWithPassword is SetSourceFile for a source PDF protected by
+// the standard security handler (V1-V4, RC4-40/128 or AES-128). AES-256
+// (revision 5/6) is not yet supported and returns an error. userPw is tried
+// first as the user password and, if that fails, as the owner password (the
+// real user password is then recovered from /O), as PDF readers
+// conventionally do; pass "" for documents that only have an owner password
+// set.
+func (importer *Importer) SetSourceFileWithPassword(f string, userPw string) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
 	importer.sourceFile = f
+	return importer.ensureReaderWriter(f, func() (*PdfReader, error) {
+		return NewPdfReaderWithPassword(f, userPw)
+	})
+}
 
-	// If reader hasn't been instantiated, do that now
-	if _, ok := importer.readers[importer.sourceFile]; !ok {
-		reader, err := NewPdfReader(importer.sourceFile)
-		if err != nil {
-			return err
-		}
-		importer.readers[importer.sourceFile] = reader
+// SetSourceStream -
+func (importer *Importer) SetSourceStream(rs *io.ReadSeeker) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	key, err := hashStream(*rs)
+	if err != nil {
+		return err
 	}
 
-	// If writer hasn't been instantiated, do that now
-	if _, ok := importer.writers[importer.sourceFile]; !ok {
-		writer, err := NewPdfWriter("")
-		if err != nil {
-			return err
-		}
+	importer.sourceFile = key
+	return importer.ensureReaderWriter(key, func() (*PdfReader, error) {
+		return NewPdfReaderFromStream(*rs)
+	})
+}
 
-		// Make the next writer start template numbers at this.tplN
-		writer.SetTplIdOffset(importer.tplN)
-		importer.writers[importer.sourceFile] = writer
+// SetSourceStreamWithID is SetSourceStream for a caller that already has a
+// stable identifier for rs (e.g. a filename or upload id) and wants to skip
+// hashing the stream to get one.
+func (importer *Importer) SetSourceStreamWithID(rs io.ReadSeeker, id string) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	importer.sourceFile = id
+	return importer.ensureReaderWriter(id, func() (*PdfReader, error) {
+		return NewPdfReaderFromStream(rs)
+	})
+}
+
+// SetSourceStreamWithPassword is SetSourceStream for a source PDF protected
+// by the standard security handler. See SetSourceFileWithPassword for
+// details on userPw.
+func (importer *Importer) SetSourceStreamWithPassword(rs *io.ReadSeeker, userPw string) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	key, err := hashStream(*rs)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	importer.sourceFile = key
+	return importer.ensureReaderWriter(key, func() (*PdfReader, error) {
+		return NewPdfReaderFromStreamWithPassword(*rs, userPw)
+	})
 }
 
-// SetSourceStream -
-func (importer *Importer) SetSourceStream(rs *io.ReadSeeker) error {
-	importer.sourceFile = fmt.Sprintf("%v", rs)
+// hashStream returns a sha256 hex digest of rs's full contents, seeking
+// back to the start afterwards so the stream can still be parsed as a PDF.
+// This gives SetSourceStream a key that is stable across runs and that
+// correctly dedupes two different io.ReadSeeker values wrapping the same
+// bytes - unlike the pointer-formatted key it replaces, which is neither.
+func hashStream(rs io.ReadSeeker) (string, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	if _, ok := importer.readers[importer.sourceFile]; !ok {
-		reader, err := NewPdfReaderFromStream(*rs)
+// ensureReaderWriter instantiates the reader (via newReader, if one isn't
+// already cached for key) and writer for key, leaving the writer's template
+// numbering to start where this importer's current tplN is. Callers must
+// hold importer.mu for writing.
+func (importer *Importer) ensureReaderWriter(key string, newReader func() (*PdfReader, error)) error {
+	if _, ok := importer.readers[key]; !ok {
+		reader, err := newReader()
 		if err != nil {
 			return err
 		}
-		importer.readers[importer.sourceFile] = reader
+		importer.readers[key] = reader
 	}
 
-	// If writer hasn't been instantiated, do that now
-	if _, ok := importer.writers[importer.sourceFile]; !ok {
+	if _, ok := importer.writers[key]; !ok {
 		writer, err := NewPdfWriter("")
 		if err != nil {
 			return err
@@ -115,7 +237,7 @@ func (importer *Importer) SetSourceStream(rs *io.ReadSeeker) error {
 
 		// Make the next writer start template numbers at this.tplN
 		writer.SetTplIdOffset(importer.tplN)
-		importer.writers[importer.sourceFile] = writer
+		importer.writers[key] = writer
 	}
 	return nil
 }
@@ -144,32 +266,186 @@ func (importer *Importer) GetPageSizes() (map[int]map[string]map[string]float64,
 
 // ImportPage -
 func (importer *Importer) ImportPage(pageno int, box string) (int, error) {
-	// If page has already been imported, return existing tplN
-	pageNameNumber := fmt.Sprintf("%s-%04d", importer.sourceFile, pageno)
-	if _, ok := importer.importedPages[pageNameNumber]; ok {
-		return importer.importedPages[pageNameNumber], nil
+	importer.mu.Lock()
+	sourceFile := importer.sourceFile
+	importer.mu.Unlock()
+
+	return importer.importPage(sourceFile, pageno, box)
+}
+
+// ImportPageFromFile imports a page from sourceFile without touching the
+// importer's "current source file" state, so it is safe to call
+// concurrently with other ImportPageFromFile/ImportPageFromStream calls
+// (or ImportPage) against the same Importer.
+func (importer *Importer) ImportPageFromFile(sourceFile string, pageno int, box string) (int, error) {
+	if err := importer.lockedEnsureReaderWriter(sourceFile, func() (*PdfReader, error) {
+		return NewPdfReader(sourceFile)
+	}); err != nil {
+		return 0, err
+	}
+
+	return importer.importPage(sourceFile, pageno, box)
+}
+
+// ImportPageFromStream is ImportPageFromFile for a source PDF read from an
+// io.ReadSeeker rather than a path on disk.
+func (importer *Importer) ImportPageFromStream(rs io.ReadSeeker, pageno int, box string) (int, error) {
+	key, err := hashStream(rs)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := importer.lockedEnsureReaderWriter(key, func() (*PdfReader, error) {
+		return NewPdfReaderFromStream(rs)
+	}); err != nil {
+		return 0, err
+	}
+
+	return importer.importPage(key, pageno, box)
+}
+
+// lockedEnsureReaderWriter is ensureReaderWriter for callers that don't
+// already hold importer.mu.
+func (importer *Importer) lockedEnsureReaderWriter(key string, newReader func() (*PdfReader, error)) error {
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+	return importer.ensureReaderWriter(key, newReader)
+}
+
+// importPage does the actual work of ImportPage/ImportPageFromFile/
+// ImportPageFromStream against the reader/writer registered under
+// sourceKey.
+//
+// Only the bookkeeping around the actual import (the already-imported
+// cache check and recording the result in tplMap/importedPages) is done
+// under importer.mu; the parsing/copying work itself - writer.ImportPage,
+// which may read a large page's content stream - runs without it held, so
+// two goroutines importing from two different source files (and therefore
+// two different PdfReader/PdfWriter pairs, each of which guards its own
+// state) make real concurrent progress instead of serializing on this one
+// lock. If two goroutines race to import the same (sourceKey, pageno) pair,
+// both may do the underlying writer.ImportPage work, but only one template
+// id is registered for the page - the template bookkeeping itself is
+// race-free. The writer still holds the other captured copy, and
+// PutFormXobjects emits it as an extra Form XObject that no registered
+// template id refers to.
+func (importer *Importer) importPage(sourceKey string, pageno int, box string) (int, error) {
+	pageNameNumber := fmt.Sprintf("%s-%04d", sourceKey, pageno)
+
+	importer.mu.Lock()
+	if tplN, ok := importer.importedPages[pageNameNumber]; ok {
+		importer.mu.Unlock()
+		return tplN, nil
 	}
+	reader := importer.readerForFile(sourceKey)
+	writer := importer.writerForFile(sourceKey)
+	importer.mu.Unlock()
 
-	res, err := importer.GetWriter().ImportPage(importer.GetReader(), pageno, box)
+	res, err := writer.ImportPage(reader, pageno, box)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
-	// Get current template id
-	tplN := importer.tplN
+	// Record the box size so the template can be reconstructed if it is
+	// later round-tripped through EncodeTemplates/DecodeTemplates
+	var boxW, boxH float64
+	if sizes, sizeErr := reader.getAllPageBoxes(1.0); sizeErr == nil {
+		if pageBoxes, ok := sizes[pageno]; ok {
+			if b, ok := pageBoxes[box]; ok {
+				boxW, boxH = b["w"], b["h"]
+			}
+		}
+	}
 
-	// Set tpl info
-	importer.tplMap[tplN] = &TplInfo{SourceFile: importer.sourceFile, TemplateId: res, Writer: importer.GetWriter()}
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
 
-	// Increment template id
-	importer.tplN++
+	// Another goroutine may have imported the same page while we were
+	// parsing it above; if so, keep its result rather than registering a
+	// second template for the same page.
+	if tplN, ok := importer.importedPages[pageNameNumber]; ok {
+		return tplN, nil
+	}
 
-	// Cache imported page tplN
+	tplN := importer.tplN
+	importer.tplMap[tplN] = &TplInfo{
+		SourceFile: sourceKey,
+		TemplateId: res,
+		Writer:     writer,
+		PageNo:     pageno,
+		Box:        box,
+		W:          boxW,
+		H:          boxH,
+	}
+	importer.tplN++
 	importer.importedPages[pageNameNumber] = tplN
 
 	return tplN, nil
 }
 
+// ImportPages imports several pages from the current source file in one
+// call and returns their template ids in the same order as pagenos. It is a
+// thin convenience wrapper around ImportPage so callers importing many
+// pages don't have to hand-write the loop; a page already imported (e.g. by
+// an earlier ImportPage or ImportPages call) is returned from cache rather
+// than re-imported.
+//
+// ImportPages does not itself add any resource deduplication beyond that:
+// any sharing across pages comes from the source file's single
+// PdfReader/PdfWriter pair, which already dedupe independently of how
+// ImportPage is called. PdfReader caches every object it has parsed, so
+// re-resolving a reference two pages both point at doesn't reparse it
+// twice, and PdfWriter's per-reference cache means a *stream* object (an
+// image, an embedded font program) referenced from more than one imported
+// page is only copied into the output once. Plain (non-stream) resources
+// like a simple Type1 font dictionary are inlined at each point of
+// reference rather than becoming shared objects, so those are duplicated
+// per template regardless of whether pages are imported one at a time or
+// via ImportPages.
+//
+// Concretely: calling ImportPages(pages, box) costs the same work as a
+// caller's own "for _, p := range pages { ImportPage(p, box) }" loop: this
+// function exists for call-site convenience, not for a speedup or a
+// dedup guarantee beyond what that hand-written loop already gets for free.
+func (importer *Importer) ImportPages(pagenos []int, box string) ([]int, error) {
+	tplNs := make([]int, len(pagenos))
+	for i, pageno := range pagenos {
+		tplN, err := importer.ImportPage(pageno, box)
+		if err != nil {
+			return nil, err
+		}
+		tplNs[i] = tplN
+	}
+	return tplNs, nil
+}
+
+// ImportAllPages imports every page of the current source file and returns
+// their template ids in page order. It is the natural companion to
+// GetPageSizes for callers that want to stamp every page of a source PDF.
+func (importer *Importer) ImportAllPages(box string) ([]int, error) {
+	numPages, err := importer.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	pagenos := make([]int, numPages)
+	for i := range pagenos {
+		pagenos[i] = i + 1
+	}
+
+	return importer.ImportPages(pagenos, box)
+}
+
+// SetNextObjectID, PutFormXobjects, PutFormXobjectsUnordered,
+// GetImportedObjects, GetImportedObjectsUnordered and GetImportedObjHashPos
+// below all go through GetWriter()/GetReader(), which only hold importer.mu
+// long enough to look up the current source file's *PdfWriter/*PdfReader.
+// That's enough to be race-free: PdfWriter and PdfReader each guard their
+// own mutable state with their own lock, so calling one of these
+// concurrently with e.g. ImportPageFromFile against the same writer/reader
+// is safe, it just serializes on that writer/reader's lock rather than on
+// importer.mu.
+
 // SetNextObjectID -
 func (importer *Importer) SetNextObjectID(objId int) {
 	importer.GetWriter().SetNextObjectID(objId)
@@ -203,11 +479,17 @@ func (importer *Importer) PutFormXobjectsUnordered() (map[string]string, error)
 }
 
 // GetImportedObjects - Get object ids (int) and their contents (string)
+//
+// The current source file's writer may be nil - e.g. for an importer that
+// only ever called DecodeTemplates - in which case this simply returns no
+// live objects; decoded objects are only ever hash-keyed, so they surface
+// through GetImportedObjectsUnordered instead.
 func (importer *Importer) GetImportedObjects() map[int]string {
 	res := make(map[int]string, 0)
-	pdfObjIdBytes := importer.GetWriter().GetImportedObjects()
-	for pdfObjId, bytes := range pdfObjIdBytes {
-		res[pdfObjId.id] = string(bytes)
+	if writer := importer.GetWriter(); writer != nil {
+		for pdfObjId, bytes := range writer.GetImportedObjects() {
+			res[pdfObjId.id] = string(bytes)
+		}
 	}
 	return res
 }
@@ -215,22 +497,44 @@ func (importer *Importer) GetImportedObjects() map[int]string {
 // GetImportedObjectsUnordered -Get object ids (sha1 hash) and their contents ([]byte)
 // The contents may have references to other object hashes which will need to be replaced by the pdf generator library
 // The positions of the hashes (sha1 - 40 characters) can be obtained by calling GetImportedObjHashPos()
+//
+// The current source file's writer may be nil - e.g. for an importer that
+// only ever called DecodeTemplates - in which case this returns just the
+// decoded objects restored by that call.
 func (importer *Importer) GetImportedObjectsUnordered() map[string][]byte {
 	res := make(map[string][]byte, 0)
-	pdfObjIdBytes := importer.GetWriter().GetImportedObjects()
-	for pdfObjId, bytes := range pdfObjIdBytes {
-		res[pdfObjId.hash] = bytes
+	if writer := importer.GetWriter(); writer != nil {
+		for pdfObjId, bytes := range writer.GetImportedObjects() {
+			res[pdfObjId.hash] = bytes
+		}
+	}
+
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	for hash, bytes := range importer.decodedObjects {
+		res[hash] = bytes
 	}
 	return res
 }
 
 // GetImportedObjHashPos -Get the positions of the hashes (sha1 - 40 characters) within each object, to be replaced with
 // actual objects ids by the pdf generator library
+//
+// The current source file's writer may be nil - e.g. for an importer that
+// only ever called DecodeTemplates - in which case this returns just the
+// decoded hash positions restored by that call.
 func (importer *Importer) GetImportedObjHashPos() map[string]map[int]string {
 	res := make(map[string]map[int]string, 0)
-	pdfObjIdPosHash := importer.GetWriter().GetImportedObjHashPos()
-	for pdfObjId, posHashMap := range pdfObjIdPosHash {
-		res[pdfObjId.hash] = posHashMap
+	if writer := importer.GetWriter(); writer != nil {
+		for pdfObjId, posHashMap := range writer.GetImportedObjHashPos() {
+			res[pdfObjId.hash] = posHashMap
+		}
+	}
+
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+	for hash, posHashMap := range importer.decodedHashPos {
+		res[hash] = posHashMap
 	}
 	return res
 }
@@ -238,7 +542,35 @@ func (importer *Importer) GetImportedObjHashPos() map[string]map[int]string {
 // UseTemplate -For a given template id (returned from ImportPage), get the template name (e.g. /GOFPDITPL1) and
 // the 4 float64 values necessary to draw the template a x,y for a given width and height.
 func (importer *Importer) UseTemplate(tplid int, _x float64, _y float64, _w float64, _h float64) (string, float64, float64, float64, float64) {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+
 	// Look up template id in importer tpl map
 	tplInfo := importer.tplMap[tplid]
+
+	// Templates restored via DecodeTemplates have no live Writer (the
+	// source PDF that produced them was never reopened in this process),
+	// so scale them against the box dimensions captured at encode time.
+	if tplInfo.Writer == nil {
+		name := fmt.Sprintf("/GOFPDITPL%d", tplInfo.TemplateId)
+		x, y, w, h := scaleTemplateBox(tplInfo.W, tplInfo.H, _x, _y, _w, _h)
+		return name, x, y, w, h
+	}
+
 	return tplInfo.Writer.UseTemplate(tplInfo.TemplateId, _x, _y, _w, _h)
 }
+
+// scaleTemplateBox fills in a missing width or height for UseTemplate from
+// the source box's aspect ratio, matching the scaling PdfWriter.UseTemplate
+// applies for templates backed by a live writer.
+func scaleTemplateBox(boxW, boxH, x, y, w, h float64) (float64, float64, float64, float64) {
+	if w == 0 && h == 0 {
+		w = boxW
+		h = boxH
+	} else if w == 0 && h != 0 {
+		w = h * boxW / boxH
+	} else if h == 0 && w != 0 {
+		h = w * boxH / boxW
+	}
+	return x, y, w, h
+}
@@ -0,0 +1,368 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// This file implements a small recursive-descent parser for the subset of
+// PDF object syntax gofpdi needs to read: dictionaries, arrays, names,
+// strings, numbers, booleans, null, indirect references and streams. It
+// does not handle object streams or cross-reference streams (PDF 1.5+
+// compressed xref) - only the classic "xref" table plus "trailer" that
+// every PDF writer in the wild still emits alongside them for
+// compatibility.
+
+// pdfName is a PDF name object, stored without its leading "/".
+type pdfName string
+
+// pdfRef is an indirect reference, "num gen R".
+type pdfRef struct {
+	Num int
+	Gen int
+}
+
+// pdfDict is a PDF dictionary, "<< ... >>".
+type pdfDict map[string]interface{}
+
+// pdfArray is a PDF array, "[ ... ]".
+type pdfArray []interface{}
+
+// pdfStream is an indirect object with a dictionary and a stream body.
+type pdfStream struct {
+	Dict pdfDict
+	Data []byte
+}
+
+// pdfParser tokenizes and parses PDF object syntax out of a byte buffer.
+type pdfParser struct {
+	buf []byte
+	pos int
+}
+
+func newPdfParser(buf []byte) *pdfParser {
+	return &pdfParser{buf: buf}
+}
+
+func isPdfWhitespace(b byte) bool {
+	switch b {
+	case 0x00, 0x09, 0x0A, 0x0C, 0x0D, 0x20:
+		return true
+	}
+	return false
+}
+
+func isPdfDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (p *pdfParser) skipWhitespace() {
+	for p.pos < len(p.buf) {
+		b := p.buf[p.pos]
+		if b == '%' {
+			for p.pos < len(p.buf) && p.buf[p.pos] != '\n' && p.buf[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isPdfWhitespace(b) {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *pdfParser) peekByte() (byte, bool) {
+	if p.pos >= len(p.buf) {
+		return 0, false
+	}
+	return p.buf[p.pos], true
+}
+
+func (p *pdfParser) hasPrefixAt(pos int, s string) bool {
+	if pos+len(s) > len(p.buf) {
+		return false
+	}
+	return string(p.buf[pos:pos+len(s)]) == s
+}
+
+// parseValue parses a single PDF value at the current position, including
+// folding "num gen R" into a pdfRef and "<<...>> stream...endstream" into
+// a pdfStream.
+func (p *pdfParser) parseValue() (interface{}, error) {
+	p.skipWhitespace()
+	if p.pos >= len(p.buf) {
+		return nil, fmt.Errorf("gofpdi: unexpected end of object data")
+	}
+
+	b := p.buf[p.pos]
+	switch {
+	case b == '/':
+		return p.parseName()
+	case b == '(':
+		return p.parseLiteralString()
+	case b == '<' && p.hasPrefixAt(p.pos, "<<"):
+		return p.parseDictOrStream()
+	case b == '<':
+		return p.parseHexString()
+	case b == '[':
+		return p.parseArray()
+	case p.hasPrefixAt(p.pos, "true"):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefixAt(p.pos, "false"):
+		p.pos += 5
+		return false, nil
+	case p.hasPrefixAt(p.pos, "null"):
+		p.pos += 4
+		return nil, nil
+	case b == '+' || b == '-' || b == '.' || (b >= '0' && b <= '9'):
+		return p.parseNumberOrRef()
+	default:
+		return nil, fmt.Errorf("gofpdi: unexpected byte 0x%02x at offset %d", b, p.pos)
+	}
+}
+
+func (p *pdfParser) parseName() (pdfName, error) {
+	p.pos++ // consume '/'
+	start := p.pos
+	for p.pos < len(p.buf) && !isPdfWhitespace(p.buf[p.pos]) && !isPdfDelimiter(p.buf[p.pos]) {
+		p.pos++
+	}
+	return pdfName(p.buf[start:p.pos]), nil
+}
+
+func (p *pdfParser) parseLiteralString() (string, error) {
+	p.pos++ // consume '('
+	var out bytes.Buffer
+	depth := 1
+	for p.pos < len(p.buf) {
+		c := p.buf[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.buf) {
+				break
+			}
+			esc := p.buf[p.pos]
+			switch esc {
+			case 'n':
+				out.WriteByte('\n')
+			case 'r':
+				out.WriteByte('\r')
+			case 't':
+				out.WriteByte('\t')
+			case 'b':
+				out.WriteByte('\b')
+			case 'f':
+				out.WriteByte('\f')
+			case '(', ')', '\\':
+				out.WriteByte(esc)
+			case '\r', '\n':
+				// line continuation, emit nothing
+			default:
+				out.WriteByte(esc)
+			}
+			p.pos++
+		case '(':
+			depth++
+			out.WriteByte(c)
+			p.pos++
+		case ')':
+			depth--
+			p.pos++
+			if depth == 0 {
+				return out.String(), nil
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+			p.pos++
+		}
+	}
+	return out.String(), fmt.Errorf("gofpdi: unterminated literal string")
+}
+
+func (p *pdfParser) parseHexString() (string, error) {
+	p.pos++ // consume '<'
+	start := p.pos
+	for p.pos < len(p.buf) && p.buf[p.pos] != '>' {
+		p.pos++
+	}
+	hex := string(bytes.Map(func(r rune) rune {
+		if isPdfWhitespace(byte(r)) {
+			return -1
+		}
+		return r
+	}, p.buf[start:p.pos]))
+	p.pos++ // consume '>'
+
+	if len(hex)%2 == 1 {
+		hex += "0"
+	}
+	out := make([]byte, 0, len(hex)/2)
+	for i := 0; i < len(hex); i += 2 {
+		var v int
+		if _, err := fmt.Sscanf(hex[i:i+2], "%02x", &v); err != nil {
+			return "", err
+		}
+		out = append(out, byte(v))
+	}
+	return string(out), nil
+}
+
+func (p *pdfParser) parseArray() (pdfArray, error) {
+	p.pos++ // consume '['
+	arr := pdfArray{}
+	for {
+		p.skipWhitespace()
+		if p.pos >= len(p.buf) {
+			return nil, fmt.Errorf("gofpdi: unterminated array")
+		}
+		if p.buf[p.pos] == ']' {
+			p.pos++
+			return arr, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+}
+
+func (p *pdfParser) parseDictOrStream() (interface{}, error) {
+	p.pos += 2 // consume '<<'
+	dict := pdfDict{}
+	for {
+		p.skipWhitespace()
+		if p.hasPrefixAt(p.pos, ">>") {
+			p.pos += 2
+			break
+		}
+		if p.pos >= len(p.buf) || p.buf[p.pos] != '/' {
+			return nil, fmt.Errorf("gofpdi: expected name key in dictionary")
+		}
+		key, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		dict[string(key)] = val
+	}
+
+	p.skipWhitespace()
+	if p.hasPrefixAt(p.pos, "stream") {
+		p.pos += len("stream")
+		// The stream keyword is followed by CRLF or LF (not bare CR).
+		if p.pos < len(p.buf) && p.buf[p.pos] == '\r' {
+			p.pos++
+		}
+		if p.pos < len(p.buf) && p.buf[p.pos] == '\n' {
+			p.pos++
+		}
+
+		length := 0
+		if l, ok := dict["Length"]; ok {
+			switch lv := l.(type) {
+			case float64:
+				length = int(lv)
+			}
+		}
+
+		end := p.pos + length
+		if length == 0 || end > len(p.buf) {
+			// Fall back to scanning for "endstream" when /Length is
+			// missing, wrong, or an indirect reference we can't resolve
+			// without the xref table.
+			idx := bytes.Index(p.buf[p.pos:], []byte("endstream"))
+			if idx < 0 {
+				return nil, fmt.Errorf("gofpdi: endstream not found")
+			}
+			end = p.pos + idx
+			for end > p.pos && (p.buf[end-1] == '\n' || p.buf[end-1] == '\r') {
+				end--
+			}
+		}
+
+		data := p.buf[p.pos:end]
+		p.pos = end
+		p.skipWhitespace()
+		if p.hasPrefixAt(p.pos, "endstream") {
+			p.pos += len("endstream")
+		}
+		return &pdfStream{Dict: dict, Data: data}, nil
+	}
+
+	return dict, nil
+}
+
+func (p *pdfParser) parseNumberOrRef() (interface{}, error) {
+	numStart := p.pos
+	num, err := p.parseNumberToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Look ahead for "gen R" to fold an indirect reference.
+	save := p.pos
+	p.skipWhitespace()
+	genStart := p.pos
+	if p.pos < len(p.buf) && p.buf[p.pos] >= '0' && p.buf[p.pos] <= '9' {
+		for p.pos < len(p.buf) && p.buf[p.pos] >= '0' && p.buf[p.pos] <= '9' {
+			p.pos++
+		}
+		genEnd := p.pos
+		p.skipWhitespace()
+		if p.pos < len(p.buf) && p.buf[p.pos] == 'R' && (num == float64(int(num))) {
+			gen, _ := strconv.Atoi(string(p.buf[genStart:genEnd]))
+			p.pos++
+			return pdfRef{Num: int(num), Gen: gen}, nil
+		}
+	}
+
+	// Not a reference; rewind to just after the number.
+	p.pos = save
+	_ = numStart
+	return num, nil
+}
+
+func (p *pdfParser) parseNumberToken() (float64, error) {
+	start := p.pos
+	if p.pos < len(p.buf) && (p.buf[p.pos] == '+' || p.buf[p.pos] == '-') {
+		p.pos++
+	}
+	for p.pos < len(p.buf) && ((p.buf[p.pos] >= '0' && p.buf[p.pos] <= '9') || p.buf[p.pos] == '.') {
+		p.pos++
+	}
+	v, err := strconv.ParseFloat(string(p.buf[start:p.pos]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("gofpdi: invalid number %q: %w", p.buf[start:p.pos], err)
+	}
+	return v, nil
+}
+
+// dictString is a small helper for reading a name or literal-string valued
+// dictionary entry as a plain Go string, unwrapping pdfName.
+func dictString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case pdfName:
+		return string(t), true
+	case string:
+		return t, true
+	}
+	return "", false
+}
+
+func dictNumber(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
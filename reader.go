@@ -0,0 +1,792 @@
+package gofpdi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// PdfReader parses a single PDF file (or stream) well enough to walk its
+// page tree, read page boxes, and fetch objects for the writer to copy.
+//
+// It supports the classic (non-compressed) cross-reference table plus
+// trailer that every PDF writer still emits for backwards compatibility;
+// cross-reference streams and object streams (PDF 1.5+) are not handled.
+type PdfReader struct {
+	data []byte
+
+	xref    map[int]int64 // object number -> byte offset
+	trailer pdfDict
+
+	// objCacheMu guards objCache, the only field mutated after
+	// construction (getObject lazily fills it in), so a PdfReader is safe
+	// for concurrent use once newPdfReaderFromBytes returns it. Every
+	// other field here is set up once during construction and read-only
+	// afterwards.
+	objCacheMu sync.RWMutex
+	objCache   map[int]interface{}
+
+	security *standardSecurityHandler
+
+	pages    []pdfDict // leaf page dictionaries, in document order
+	pageRefs []pdfRef
+}
+
+// NewPdfReader parses the PDF at path f.
+func NewPdfReader(f string) (*PdfReader, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return newPdfReaderFromBytes(data, "", false)
+}
+
+// NewPdfReaderFromStream parses the PDF read from rs.
+func NewPdfReaderFromStream(rs io.ReadSeeker) (*PdfReader, error) {
+	data, err := readAllFromStart(rs)
+	if err != nil {
+		return nil, err
+	}
+	return newPdfReaderFromBytes(data, "", false)
+}
+
+// NewPdfReaderWithPassword parses the PDF at path f, which may be
+// protected by the standard security handler.
+func NewPdfReaderWithPassword(f string, userPw string) (*PdfReader, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	return newPdfReaderFromBytes(data, userPw, true)
+}
+
+// NewPdfReaderFromStreamWithPassword is NewPdfReaderWithPassword for a
+// stream source.
+func NewPdfReaderFromStreamWithPassword(rs io.ReadSeeker, userPw string) (*PdfReader, error) {
+	data, err := readAllFromStart(rs)
+	if err != nil {
+		return nil, err
+	}
+	return newPdfReaderFromBytes(data, userPw, true)
+}
+
+func readAllFromStart(rs io.ReadSeeker) ([]byte, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rs)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newPdfReaderFromBytes(data []byte, userPw string, havePassword bool) (*PdfReader, error) {
+	r := &PdfReader{
+		data:     data,
+		xref:     make(map[int]int64),
+		objCache: make(map[int]interface{}),
+	}
+
+	if err := r.parseXref(); err != nil {
+		return nil, err
+	}
+
+	if enc, ok := r.trailer["Encrypt"]; ok {
+		if !havePassword {
+			return nil, fmt.Errorf("gofpdi: source PDF is encrypted; use SetSourceFileWithPassword/SetSourceStreamWithPassword")
+		}
+		if err := r.setupSecurityHandler(enc, userPw); err != nil {
+			return nil, err
+		}
+	} else if havePassword {
+		// A password was supplied for a PDF that turns out not to be
+		// encrypted; that's fine, just proceed unencrypted.
+	}
+
+	if err := r.loadPages(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// parseXref locates the xref table(s) reachable from the final startxref
+// offset and the trailer dictionary, following /Prev chains.
+func (r *PdfReader) parseXref() error {
+	idx := bytes.LastIndex(r.data, []byte("startxref"))
+	if idx < 0 {
+		return fmt.Errorf("gofpdi: startxref not found")
+	}
+
+	p := newPdfParser(r.data)
+	p.pos = idx + len("startxref")
+	p.skipWhitespace()
+	start := p.pos
+	for p.pos < len(p.buf) && p.buf[p.pos] >= '0' && p.buf[p.pos] <= '9' {
+		p.pos++
+	}
+	offset, err := strconv.ParseInt(string(r.data[start:p.pos]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("gofpdi: invalid startxref offset: %w", err)
+	}
+
+	visited := make(map[int64]bool)
+	combinedTrailer := pdfDict{}
+
+	for {
+		if offset < 0 || offset >= int64(len(r.data)) || visited[offset] {
+			break
+		}
+		visited[offset] = true
+
+		trailer, prev, err := r.parseXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		for k, v := range trailer {
+			if _, ok := combinedTrailer[k]; !ok {
+				combinedTrailer[k] = v
+			}
+		}
+
+		if prev == nil {
+			break
+		}
+		offset = *prev
+	}
+
+	r.trailer = combinedTrailer
+	if _, ok := r.trailer["Root"]; !ok {
+		return fmt.Errorf("gofpdi: trailer has no /Root entry")
+	}
+	return nil
+}
+
+// parseXrefSection parses one "xref ... trailer <<...>>" section starting
+// at offset, recording any object offsets not already known, and returns
+// its trailer dict and /Prev offset (if any).
+func (r *PdfReader) parseXrefSection(offset int64) (pdfDict, *int64, error) {
+	p := newPdfParser(r.data)
+	p.pos = int(offset)
+	p.skipWhitespace()
+
+	if !p.hasPrefixAt(p.pos, "xref") {
+		return nil, nil, fmt.Errorf("gofpdi: expected xref table at offset %d", offset)
+	}
+	p.pos += len("xref")
+
+	for {
+		p.skipWhitespace()
+		if p.hasPrefixAt(p.pos, "trailer") {
+			p.pos += len("trailer")
+			break
+		}
+		if p.pos >= len(p.buf) || p.buf[p.pos] < '0' || p.buf[p.pos] > '9' {
+			return nil, nil, fmt.Errorf("gofpdi: malformed xref subsection header")
+		}
+
+		startNum, err := p.parseNumberToken()
+		if err != nil {
+			return nil, nil, err
+		}
+		p.skipWhitespace()
+		count, err := p.parseNumberToken()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i := 0; i < int(count); i++ {
+			p.skipWhitespace()
+			entryStart := p.pos
+			for p.pos < len(p.buf) && !isPdfWhitespace(p.buf[p.pos]) {
+				p.pos++
+			}
+			entOffset, err := strconv.ParseInt(string(p.buf[entryStart:p.pos]), 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("gofpdi: malformed xref entry: %w", err)
+			}
+			p.skipWhitespace()
+			for p.pos < len(p.buf) && !isPdfWhitespace(p.buf[p.pos]) {
+				p.pos++ // generation number, unused
+			}
+			p.skipWhitespace()
+			kind := byte('n')
+			if p.pos < len(p.buf) {
+				kind = p.buf[p.pos]
+				p.pos++
+			}
+
+			objNum := int(startNum) + i
+			if kind == 'n' {
+				if _, ok := r.xref[objNum]; !ok {
+					r.xref[objNum] = entOffset
+				}
+			}
+		}
+	}
+
+	trailerVal, err := p.parseValue()
+	if err != nil {
+		return nil, nil, fmt.Errorf("gofpdi: malformed trailer: %w", err)
+	}
+	trailer, ok := trailerVal.(pdfDict)
+	if !ok {
+		return nil, nil, fmt.Errorf("gofpdi: trailer is not a dictionary")
+	}
+
+	var prev *int64
+	if pv, ok := trailer["Prev"]; ok {
+		if n, ok := dictNumber(pv); ok {
+			v := int64(n)
+			prev = &v
+		}
+	}
+
+	return trailer, prev, nil
+}
+
+// getObject parses and returns object num's value, decrypting strings and
+// stream data in place if the document is encrypted. Results are cached.
+func (r *PdfReader) getObject(num int) (interface{}, error) {
+	r.objCacheMu.RLock()
+	v, ok := r.objCache[num]
+	r.objCacheMu.RUnlock()
+	if ok {
+		return v, nil
+	}
+
+	offset, ok := r.xref[num]
+	if !ok {
+		return nil, fmt.Errorf("gofpdi: object %d not found in xref", num)
+	}
+
+	p := newPdfParser(r.data)
+	p.pos = int(offset)
+	p.skipWhitespace()
+
+	if _, err := p.parseNumberToken(); err != nil { // object number
+		return nil, fmt.Errorf("gofpdi: malformed object %d header: %w", num, err)
+	}
+	p.skipWhitespace()
+	genF, err := p.parseNumberToken() // generation number
+	if err != nil {
+		return nil, fmt.Errorf("gofpdi: malformed object %d header: %w", num, err)
+	}
+	gen := int(genF)
+	p.skipWhitespace()
+	if !p.hasPrefixAt(p.pos, "obj") {
+		return nil, fmt.Errorf("gofpdi: expected 'obj' keyword for object %d", num)
+	}
+	p.pos += len("obj")
+
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, fmt.Errorf("gofpdi: malformed object %d: %w", num, err)
+	}
+
+	if r.security != nil {
+		val = r.decryptValue(val, num, gen)
+	}
+
+	r.objCacheMu.Lock()
+	r.objCache[num] = val
+	r.objCacheMu.Unlock()
+	return val, nil
+}
+
+// resolve follows v if it is an indirect reference, otherwise returns it
+// unchanged.
+func (r *PdfReader) resolve(v interface{}) (interface{}, error) {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return v, nil
+	}
+	return r.getObject(ref.Num)
+}
+
+func (r *PdfReader) resolveDict(v interface{}) (pdfDict, error) {
+	rv, err := r.resolve(v)
+	if err != nil {
+		return nil, err
+	}
+	switch t := rv.(type) {
+	case pdfDict:
+		return t, nil
+	case *pdfStream:
+		return t.Dict, nil
+	default:
+		return nil, fmt.Errorf("gofpdi: expected dictionary, got %T", rv)
+	}
+}
+
+func (r *PdfReader) decryptValue(v interface{}, objNum, gen int) interface{} {
+	switch t := v.(type) {
+	case string:
+		out, err := r.security.decrypt([]byte(t), objNum, gen)
+		if err != nil {
+			return t
+		}
+		return string(out)
+	case pdfDict:
+		out := make(pdfDict, len(t))
+		for k, val := range t {
+			out[k] = r.decryptValue(val, objNum, gen)
+		}
+		return out
+	case pdfArray:
+		out := make(pdfArray, len(t))
+		for i, val := range t {
+			out[i] = r.decryptValue(val, objNum, gen)
+		}
+		return out
+	case *pdfStream:
+		data, err := r.security.decrypt(t.Data, objNum, gen)
+		if err != nil {
+			data = t.Data
+		}
+		dict, _ := r.decryptValue(t.Dict, objNum, gen).(pdfDict)
+		return &pdfStream{Dict: dict, Data: data}
+	default:
+		return v
+	}
+}
+
+func (r *PdfReader) setupSecurityHandler(encVal interface{}, userPw string) error {
+	encDict, err := r.resolveDict(encVal)
+	if err != nil {
+		return fmt.Errorf("gofpdi: malformed /Encrypt entry: %w", err)
+	}
+
+	filter, _ := dictString(encDict["Filter"])
+	if filter != "" && filter != "Standard" {
+		return fmt.Errorf("gofpdi: unsupported security handler %q", filter)
+	}
+
+	v := 1
+	if n, ok := dictNumber(encDict["V"]); ok {
+		v = int(n)
+	}
+	rev := 2
+	if n, ok := dictNumber(encDict["R"]); ok {
+		rev = int(n)
+	}
+	if rev >= 5 {
+		return fmt.Errorf("gofpdi: AES-256 (revision 5/6) encrypted PDFs are not yet supported")
+	}
+
+	length := 40
+	if n, ok := dictNumber(encDict["Length"]); ok {
+		length = int(n)
+	}
+
+	useAES := false
+	if v == 4 {
+		if cf, ok := encDict["CF"].(pdfDict); ok {
+			stmF, _ := dictString(encDict["StmF"])
+			if stmF != "" {
+				if filterDict, ok := cf[stmF].(pdfDict); ok {
+					cfm, _ := dictString(filterDict["CFM"])
+					if cfm == "AESV2" {
+						useAES = true
+						length = 128
+					}
+				}
+			}
+		}
+	}
+
+	o, _ := dictString(encDict["O"])
+	u, _ := dictString(encDict["U"])
+	p := 0
+	if n, ok := dictNumber(encDict["P"]); ok {
+		p = int(int32(n))
+	}
+
+	encryptMetadata := true
+	if b, ok := encDict["EncryptMetadata"].(bool); ok {
+		encryptMetadata = b
+	}
+
+	idArr, _ := r.trailer["ID"].(pdfArray)
+	var id0 []byte
+	if len(idArr) > 0 {
+		if s, ok := idArr[0].(string); ok {
+			id0 = []byte(s)
+		}
+	}
+
+	handler := &standardSecurityHandler{
+		v:               v,
+		r:               rev,
+		length:          length / 8,
+		o:               []byte(o),
+		u:               []byte(u),
+		p:               p,
+		id0:             id0,
+		encryptMetadata: encryptMetadata,
+		useAES:          useAES,
+	}
+
+	// Per PDF convention, the single password callers supply is tried first
+	// as the user password (algorithm 6) and, if that fails, as the owner
+	// password (algorithm 7, which recovers the real user password from /O
+	// and authenticates with that instead).
+	if err := handler.authenticate(userPw); err != nil {
+		if ownerErr := handler.authenticateAsOwner(userPw); ownerErr != nil {
+			return err
+		}
+	}
+
+	r.security = handler
+	return nil
+}
+
+// loadPages walks the page tree from the trailer's /Root and flattens it
+// into r.pages/r.pageRefs in document order.
+func (r *PdfReader) loadPages() error {
+	root, err := r.resolveDict(r.trailer["Root"])
+	if err != nil {
+		return fmt.Errorf("gofpdi: malformed /Root: %w", err)
+	}
+
+	pagesRef, ok := root["Pages"]
+	if !ok {
+		return fmt.Errorf("gofpdi: catalog has no /Pages entry")
+	}
+
+	return r.walkPages(pagesRef, pdfDict{}, map[int]bool{})
+}
+
+func (r *PdfReader) walkPages(ref interface{}, inherited pdfDict, seen map[int]bool) error {
+	if rf, ok := ref.(pdfRef); ok {
+		if seen[rf.Num] {
+			return fmt.Errorf("gofpdi: cyclic page tree detected at object %d", rf.Num)
+		}
+		seen[rf.Num] = true
+	}
+
+	node, err := r.resolveDict(ref)
+	if err != nil {
+		return err
+	}
+
+	merged := pdfDict{}
+	for k, v := range inherited {
+		merged[k] = v
+	}
+	for _, k := range []string{"Resources", "MediaBox", "CropBox", "Rotate"} {
+		if v, ok := node[k]; ok {
+			merged[k] = v
+		}
+	}
+
+	nodeType, _ := dictString(node["Type"])
+	if nodeType == "Pages" || node["Kids"] != nil {
+		kids, _ := node["Kids"].(pdfArray)
+		for _, kid := range kids {
+			if err := r.walkPages(kid, merged, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	page := pdfDict{}
+	for k, v := range merged {
+		page[k] = v
+	}
+	for k, v := range node {
+		page[k] = v
+	}
+
+	r.pages = append(r.pages, page)
+	if rf, ok := ref.(pdfRef); ok {
+		r.pageRefs = append(r.pageRefs, rf)
+	} else {
+		r.pageRefs = append(r.pageRefs, pdfRef{})
+	}
+	return nil
+}
+
+func (r *PdfReader) getNumPages() (int, error) {
+	return len(r.pages), nil
+}
+
+// boxRect resolves box name (with or without a leading "/") on page,
+// returning its x, y, width and height scaled by unit.
+func (r *PdfReader) boxRect(page pdfDict, box string, unit float64) (x, y, w, h float64, err error) {
+	name := box
+	if len(name) > 0 && name[0] == '/' {
+		name = name[1:]
+	}
+
+	v, ok := page[name]
+	if !ok {
+		v, ok = page["MediaBox"]
+		if !ok {
+			return 0, 0, 0, 0, fmt.Errorf("gofpdi: page has no %s or /MediaBox", box)
+		}
+	}
+
+	rv, err := r.resolve(v)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	arr, ok := rv.(pdfArray)
+	if !ok || len(arr) != 4 {
+		return 0, 0, 0, 0, fmt.Errorf("gofpdi: malformed box %s", box)
+	}
+
+	nums := make([]float64, 4)
+	for i, v := range arr {
+		rv, err := r.resolve(v)
+		if err != nil {
+			return 0, 0, 0, 0, err
+		}
+		n, ok := dictNumber(rv)
+		if !ok {
+			return 0, 0, 0, 0, fmt.Errorf("gofpdi: malformed box %s", box)
+		}
+		nums[i] = n
+	}
+
+	x0, y0, x1, y1 := nums[0], nums[1], nums[2], nums[3]
+	if x1 < x0 {
+		x0, x1 = x1, x0
+	}
+	if y1 < y0 {
+		y0, y1 = y1, y0
+	}
+
+	return x0 * unit, y0 * unit, (x1 - x0) * unit, (y1 - y0) * unit, nil
+}
+
+func (r *PdfReader) getAllPageBoxes(unit float64) (map[int]map[string]map[string]float64, error) {
+	result := make(map[int]map[string]map[string]float64, len(r.pages))
+	boxNames := []string{"MediaBox", "CropBox", "BleedBox", "TrimBox", "ArtBox"}
+
+	for i, page := range r.pages {
+		pageBoxes := make(map[string]map[string]float64)
+		for _, name := range boxNames {
+			if _, ok := page[name]; !ok && name != "MediaBox" {
+				continue
+			}
+			x, y, w, h, err := r.boxRect(page, name, unit)
+			if err != nil {
+				continue
+			}
+			pageBoxes["/"+name] = map[string]float64{"x": x, "y": y, "w": w, "h": h}
+		}
+		result[i+1] = pageBoxes
+	}
+
+	return result, nil
+}
+
+// getPageContent returns the page's (possibly multi-stream) content bytes
+// and its resolved /Resources dictionary.
+func (r *PdfReader) getPageContent(pageno int) ([]byte, pdfDict, error) {
+	if pageno < 1 || pageno > len(r.pages) {
+		return nil, nil, fmt.Errorf("gofpdi: page %d does not exist", pageno)
+	}
+	page := r.pages[pageno-1]
+
+	var content bytes.Buffer
+	contents, err := r.resolve(page["Contents"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch c := contents.(type) {
+	case *pdfStream:
+		content.Write(c.Data)
+	case pdfArray:
+		for _, part := range c {
+			rv, err := r.resolve(part)
+			if err != nil {
+				return nil, nil, err
+			}
+			if s, ok := rv.(*pdfStream); ok {
+				content.Write(s.Data)
+				content.WriteByte('\n')
+			}
+		}
+	}
+
+	resources, _ := r.resolveDict(page["Resources"])
+	return content.Bytes(), resources, nil
+}
+
+// getPageAnnotations returns the page's /Annots, optionally restricted to
+// /Link annotations, with rects translated into box's user space - the same
+// space PdfWriter.emitFormXObject puts the Form XObject's content in by
+// baking a Matrix [1 0 0 1 -boxX -boxY] translation of box's own origin, so
+// an annotation's X/Y line up with UseTemplate's placement of the template
+// regardless of which box was imported or where it sits relative to the
+// page's /MediaBox.
+func (r *PdfReader) getPageAnnotations(pageno int, box string, all bool) ([]ImportedAnnotation, error) {
+	if pageno < 1 || pageno > len(r.pages) {
+		return nil, fmt.Errorf("gofpdi: page %d does not exist", pageno)
+	}
+	page := r.pages[pageno-1]
+
+	boxX, boxY, _, _, err := r.boxRect(page, box, 1.0)
+	if err != nil {
+		return nil, err
+	}
+
+	annotsVal, err := r.resolve(page["Annots"])
+	if err != nil {
+		return nil, err
+	}
+	annotRefs, _ := annotsVal.(pdfArray)
+
+	var out []ImportedAnnotation
+	for _, a := range annotRefs {
+		annot, err := r.resolveDict(a)
+		if err != nil {
+			continue
+		}
+
+		subtype, _ := dictString(annot["Subtype"])
+		if !all && subtype != "Link" {
+			continue
+		}
+
+		ia := ImportedAnnotation{Subtype: "/" + subtype}
+
+		if rectVal, err := r.resolve(annot["Rect"]); err == nil {
+			if rect, ok := rectVal.(pdfArray); ok && len(rect) == 4 {
+				nums := make([]float64, 4)
+				for i, v := range rect {
+					if n, ok := dictNumber(v); ok {
+						nums[i] = n
+					}
+				}
+				ia.X, ia.Y = nums[0]-boxX, nums[1]-boxY
+				ia.W, ia.H = nums[2]-nums[0], nums[3]-nums[1]
+			}
+		}
+
+		action, _ := annot["A"].(pdfDict)
+		dest := annot["Dest"]
+		if action != nil {
+			actionType, _ := dictString(action["S"])
+			switch actionType {
+			case "URI":
+				ia.URI, _ = dictString(action["URI"])
+			case "GoTo":
+				dest = action["D"]
+			}
+		}
+		if ia.URI == "" {
+			ia.GoToPage = r.resolveDestPage(dest)
+		}
+
+		out = append(out, ia)
+	}
+
+	return out, nil
+}
+
+// resolveDestPage resolves a direct-array PDF destination (e.g.
+// [pageRef /XYZ left top zoom]) to a 1-based page number. Named
+// destinations (looked up via the /Names tree) are not supported and
+// resolve to 0.
+func (r *PdfReader) resolveDestPage(dest interface{}) int {
+	arr, ok := dest.(pdfArray)
+	if !ok || len(arr) == 0 {
+		return 0
+	}
+	ref, ok := arr[0].(pdfRef)
+	if !ok {
+		return 0
+	}
+	for i, pr := range r.pageRefs {
+		if pr == ref {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// getOutlines flattens the source document's outline (bookmark) tree into
+// a slice, depth-first.
+func (r *PdfReader) getOutlines() ([]ImportedOutline, error) {
+	root, err := r.resolveDict(r.trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+
+	outlinesVal, ok := root["Outlines"]
+	if !ok {
+		return nil, nil
+	}
+	outlines, err := r.resolveDict(outlinesVal)
+	if err != nil {
+		return nil, nil
+	}
+
+	var result []ImportedOutline
+	first, ok := outlines["First"]
+	if !ok {
+		return nil, nil
+	}
+
+	r.walkOutlines(first, &result, map[int]bool{})
+	return result, nil
+}
+
+func (r *PdfReader) walkOutlines(ref interface{}, out *[]ImportedOutline, seen map[int]bool) {
+	rf, isRef := ref.(pdfRef)
+	if isRef {
+		if seen[rf.Num] {
+			return
+		}
+		seen[rf.Num] = true
+	}
+
+	item, err := r.resolveDict(ref)
+	if err != nil {
+		return
+	}
+
+	title, _ := dictString(item["Title"])
+	entry := ImportedOutline{Title: title}
+
+	dest := item["Dest"]
+	if action, ok := item["A"].(pdfDict); ok {
+		if s, _ := dictString(action["S"]); s == "GoTo" {
+			dest = action["D"]
+		}
+	}
+	if arr, ok := dest.(pdfArray); ok {
+		entry.Page = r.resolveDestPage(arr)
+		if len(arr) >= 4 {
+			if n, ok := dictNumber(arr[2]); ok {
+				entry.X = n
+			}
+			if n, ok := dictNumber(arr[3]); ok {
+				entry.Y = n
+			}
+		}
+	} else {
+		entry.Page = r.resolveDestPage(dest)
+	}
+
+	*out = append(*out, entry)
+
+	if first, ok := item["First"]; ok {
+		r.walkOutlines(first, out, seen)
+	}
+	if next, ok := item["Next"]; ok {
+		r.walkOutlines(next, out, seen)
+	}
+}
@@ -0,0 +1,259 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPageSpec describes one page of a fixture PDF built by buildTestPDF.
+type testPageSpec struct {
+	content  string
+	fontRef  bool // if true, /Resources references the shared font object
+	imageRef bool // if true, /Resources references the shared image XObject stream
+}
+
+// testEncryptSpec, if non-nil, tells buildTestPDF to add a standard-security-
+// handler /Encrypt dict (RC4 only - AES is covered independently in
+// crypt_test.go) and encrypt the content streams with it.
+type testEncryptSpec struct {
+	r, lengthBits   int
+	ownerPw, userPw string
+}
+
+// buildTestPDF writes a minimal, hand-assembled classic-xref PDF with one
+// object per page content stream, an optional shared font resource (a plain
+// dictionary, which PdfWriter inlines at each reference), an optional shared
+// image XObject stream (which PdfWriter's per-reference cache copies only
+// once), and optional RC4 encryption. It returns the file path.
+//
+// RC4 is a self-inverse stream cipher, so encrypting the fixture's content
+// streams is done by calling the real (standardSecurityHandler).decrypt
+// once before embedding them - the crypto primitives themselves are checked
+// independently (and not via self-inverse round-tripping) in crypt_test.go;
+// this fixture exists to exercise the reader's xref/object-parsing and
+// password-handling wiring, not the cipher math.
+func buildTestPDF(t *testing.T, pages []testPageSpec, enc *testEncryptSpec) string {
+	t.Helper()
+
+	const (
+		objCatalog = 1
+		objPages   = 2
+		objFont    = 3
+		objImage   = 4
+	)
+	firstPageObj := 5 // page N and its content stream follow, two objects per page
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make(map[int]int64)
+
+	writeObj := func(num int, dict string, stream []byte) {
+		offsets[num] = int64(buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s", num, dict)
+		if stream != nil {
+			buf.WriteString("\nstream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream")
+		}
+		buf.WriteString("\nendobj\n")
+	}
+
+	id0 := []byte("0123456789ABCDEF")
+
+	var h *standardSecurityHandler
+	if enc != nil {
+		h = buildStandardSecurityHandler(t, enc.r, enc.lengthBits, false, enc.ownerPw, enc.userPw, id0, -4)
+		if err := h.authenticate(enc.userPw); err != nil {
+			t.Fatalf("fixture handler failed to self-authenticate: %v", err)
+		}
+	}
+
+	kidRefs := make([]string, len(pages))
+	for i := range pages {
+		kidRefs[i] = fmt.Sprintf("%d 0 R", firstPageObj+2*i)
+	}
+
+	writeObj(objCatalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", objPages), nil)
+	writeObj(objPages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", joinRefs(kidRefs), len(pages)), nil)
+	writeObj(objFont, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>", nil)
+	writeObj(objImage, "<< /Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Length 1 >>", []byte{0x80})
+
+	for i, pg := range pages {
+		pageObjNum := firstPageObj + 2*i
+		contentObjNum := pageObjNum + 1
+
+		resEntries := ""
+		if pg.fontRef {
+			resEntries += fmt.Sprintf(" /Font << /F1 %d 0 R >>", objFont)
+		}
+		if pg.imageRef {
+			resEntries += fmt.Sprintf(" /XObject << /Im1 %d 0 R >>", objImage)
+		}
+		resources := fmt.Sprintf("<<%s >>", resEntries)
+		pageDict := fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 200 300] /Resources %s /Contents %d 0 R >>",
+			objPages, resources, contentObjNum,
+		)
+		writeObj(pageObjNum, pageDict, nil)
+
+		data := []byte(pg.content)
+		if h != nil {
+			encData, err := h.decrypt(data, contentObjNum, 0) // RC4 is self-inverse
+			if err != nil {
+				t.Fatal(err)
+			}
+			data = encData
+		}
+		streamDict := fmt.Sprintf("<< /Length %d >>", len(data))
+		writeObj(contentObjNum, streamDict, data)
+	}
+
+	lastObj := firstPageObj + 2*len(pages) - 1
+	encryptObjNum := 0
+	if enc != nil {
+		encryptObjNum = lastObj + 1
+		encDict := fmt.Sprintf(
+			"<< /Filter /Standard /V 2 /R %d /O <%s> /U <%s> /P -4 /Length %d >>",
+			enc.r, hex.EncodeToString(h.o), hex.EncodeToString(h.u), enc.lengthBits,
+		)
+		writeObj(encryptObjNum, encDict, nil)
+		lastObj = encryptObjNum
+	}
+
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n", lastObj+1)
+	buf.WriteString("0000000000 65535 f \n")
+	for n := 1; n <= lastObj; n++ {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offsets[n])
+	}
+
+	trailer := fmt.Sprintf("<< /Size %d /Root %d 0 R", lastObj+1, objCatalog)
+	if enc != nil {
+		trailer += fmt.Sprintf(" /Encrypt %d 0 R /ID [<%s> <%s>]", encryptObjNum, hex.EncodeToString(id0), hex.EncodeToString(id0))
+	}
+	trailer += " >>"
+
+	buf.WriteString("trailer\n")
+	buf.WriteString(trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF", xrefOffset)
+
+	path := filepath.Join(t.TempDir(), "fixture.pdf")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func joinRefs(refs []string) string {
+	out := ""
+	for i, r := range refs {
+		if i > 0 {
+			out += " "
+		}
+		out += r
+	}
+	return out
+}
+
+func TestReaderPagesAndBoxes(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT /F1 12 Tf (hi) Tj ET"}}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := importer.GetNumPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("GetNumPages() = %d, want 1", n)
+	}
+
+	sizes, err := importer.GetPageSizes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	box := sizes[1]["/MediaBox"]
+	if box["w"] != 200 || box["h"] != 300 {
+		t.Fatalf("MediaBox = %+v, want w=200 h=300", box)
+	}
+}
+
+func TestImportPageAndPutFormXobjects(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (hi) Tj ET", fontRef: true}}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tplN, err := importer.ImportPage(1, "/MediaBox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tplNames, err := importer.PutFormXobjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("/GOFPDITPL%d", tplN)
+	if _, ok := tplNames[name]; !ok {
+		t.Fatalf("PutFormXobjects() missing %s, got %+v", name, tplNames)
+	}
+
+	objs := importer.GetImportedObjects()
+	objID := tplNames[name]
+	if !bytes.Contains([]byte(objs[objID]), []byte("/Subtype/Form")) && !bytes.Contains([]byte(objs[objID]), []byte("/Subtype /Form")) {
+		t.Fatalf("emitted object does not look like a Form XObject: %s", objs[objID])
+	}
+}
+
+func TestSetSourceFileWithPassword(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (secret content) Tj ET"}}, &testEncryptSpec{
+		r: 3, lengthBits: 128, ownerPw: "owner", userPw: "secret",
+	})
+
+	importer := NewImporter()
+	if err := importer.SetSourceFileWithPassword(path, "secret"); err != nil {
+		t.Fatalf("SetSourceFileWithPassword with correct password failed: %v", err)
+	}
+	if _, err := importer.ImportPage(1, "/MediaBox"); err != nil {
+		t.Fatalf("ImportPage on decrypted source failed: %v", err)
+	}
+
+	wrong := NewImporter()
+	if err := wrong.SetSourceFileWithPassword(path, "nope"); err == nil {
+		t.Fatalf("SetSourceFileWithPassword with wrong password unexpectedly succeeded")
+	}
+}
+
+func TestSetSourceFileWithOwnerPassword(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (secret content) Tj ET"}}, &testEncryptSpec{
+		r: 3, lengthBits: 128, ownerPw: "boss", userPw: "secret",
+	})
+
+	importer := NewImporter()
+	if err := importer.SetSourceFileWithPassword(path, "boss"); err != nil {
+		t.Fatalf("SetSourceFileWithPassword with owner password failed: %v", err)
+	}
+	if _, err := importer.ImportPage(1, "/MediaBox"); err != nil {
+		t.Fatalf("ImportPage on owner-unlocked source failed: %v", err)
+	}
+}
+
+func TestSetSourceFileWithoutPasswordRejectsEncrypted(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (secret content) Tj ET"}}, &testEncryptSpec{
+		r: 3, lengthBits: 128, ownerPw: "owner", userPw: "secret",
+	})
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err == nil {
+		t.Fatalf("SetSourceFile on an encrypted PDF unexpectedly succeeded without a password")
+	}
+}
@@ -0,0 +1,137 @@
+package gofpdi
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// templateCacheVersion is bumped whenever the wire format written by
+// EncodeTemplates changes in a way that DecodeTemplates from an older
+// version cannot read.
+const templateCacheVersion = 1
+
+// templateCacheEntry is the serializable form of a TplInfo.
+type templateCacheEntry struct {
+	OldTplN    int
+	SourceFile string
+	TemplateId int
+	PageNo     int
+	Box        string
+	W          float64
+	H          float64
+}
+
+// templateCache is the gob-encoded payload written by EncodeTemplates and
+// read back by DecodeTemplates.
+type templateCache struct {
+	Version int
+	Entries []templateCacheEntry
+	Objects map[string][]byte
+	HashPos map[string]map[int]string
+}
+
+// EncodeTemplates serializes every template imported so far - the tplMap
+// plus the underlying hashed object bytes and their hash positions from
+// every writer the importer has created - so it can be written to disk and
+// restored by DecodeTemplates in a later process without re-parsing the
+// source PDF(s).
+//
+// Templates must be addressed by hash rather than sequential object id for
+// this to round-trip correctly, even for writers that have already emitted
+// some templates under sequential ids via PutFormXobjects (the default
+// path). So for each writer, EncodeTemplates replays its templates through
+// emitAllHashed, which re-emits everything in hash mode via a disposable
+// writer rather than mutating the real one - this leaves the writer's own
+// id assignments and GetImportedObjects()/GetImportedObjHashPos() results
+// completely unaffected by the call.
+func (importer *Importer) EncodeTemplates(w io.Writer) error {
+	importer.mu.RLock()
+	defer importer.mu.RUnlock()
+
+	cache := templateCache{
+		Version: templateCacheVersion,
+		Objects: make(map[string][]byte),
+		HashPos: make(map[string]map[int]string),
+	}
+
+	for tplN, info := range importer.tplMap {
+		cache.Entries = append(cache.Entries, templateCacheEntry{
+			OldTplN:    tplN,
+			SourceFile: info.SourceFile,
+			TemplateId: info.TemplateId,
+			PageNo:     info.PageNo,
+			Box:        info.Box,
+			W:          info.W,
+			H:          info.H,
+		})
+	}
+
+	for key, writer := range importer.writers {
+		objects, hashPos, err := writer.emitAllHashed(importer.readers[key])
+		if err != nil {
+			return err
+		}
+
+		for pdfObjId, bytes := range objects {
+			cache.Objects[pdfObjId.hash] = bytes
+		}
+		for pdfObjId, posHashMap := range hashPos {
+			cache.HashPos[pdfObjId.hash] = posHashMap
+		}
+	}
+
+	// Carry forward objects restored by an earlier DecodeTemplates call
+	// that this importer never re-parsed a live writer for.
+	for hash, bytes := range importer.decodedObjects {
+		cache.Objects[hash] = bytes
+	}
+	for hash, posHashMap := range importer.decodedHashPos {
+		cache.HashPos[hash] = posHashMap
+	}
+
+	return gob.NewEncoder(w).Encode(&cache)
+}
+
+// DecodeTemplates reads a cache written by EncodeTemplates and re-populates
+// the importer's tplMap with the cached templates, without reopening the
+// original source file(s). It returns a map of the encoded (old) template
+// ids to the new template ids assigned by this importer, so callers that
+// stored the old ids alongside UseTemplate calls can remap them.
+func (importer *Importer) DecodeTemplates(r io.Reader) (map[int]int, error) {
+	var cache templateCache
+	if err := gob.NewDecoder(r).Decode(&cache); err != nil {
+		return nil, err
+	}
+
+	if cache.Version != templateCacheVersion {
+		return nil, fmt.Errorf("gofpdi: template cache version mismatch (got %d, want %d)", cache.Version, templateCacheVersion)
+	}
+
+	importer.mu.Lock()
+	defer importer.mu.Unlock()
+
+	for hash, bytes := range cache.Objects {
+		importer.decodedObjects[hash] = bytes
+	}
+	for hash, posHashMap := range cache.HashPos {
+		importer.decodedHashPos[hash] = posHashMap
+	}
+
+	remap := make(map[int]int, len(cache.Entries))
+	for _, entry := range cache.Entries {
+		newTplN := importer.tplN
+		importer.tplMap[newTplN] = &TplInfo{
+			SourceFile: entry.SourceFile,
+			TemplateId: entry.TemplateId,
+			PageNo:     entry.PageNo,
+			Box:        entry.Box,
+			W:          entry.W,
+			H:          entry.H,
+		}
+		importer.tplN++
+		remap[entry.OldTplN] = newTplN
+	}
+
+	return remap, nil
+}
@@ -0,0 +1,131 @@
+package gofpdi
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+)
+
+// TestEncodeTemplatesAfterPutFormXobjects checks that EncodeTemplates
+// produces a distinct, complete hash-keyed object for every template even
+// when the caller already emitted them under sequential ids via
+// PutFormXobjects beforehand - previously this collided every such
+// template's bytes into cache.Objects[""], silently discarding all but one.
+func TestEncodeTemplatesAfterPutFormXobjects(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{
+		{content: "BT (page one) Tj ET"},
+		{content: "BT (page two) Tj ET"},
+	}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.ImportPage(1, "/MediaBox"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.ImportPage(2, "/MediaBox"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.PutFormXobjects(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := importer.EncodeTemplates(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var cache templateCache
+	if err := gob.NewDecoder(&buf).Decode(&cache); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Entries) != 2 {
+		t.Fatalf("cache has %d entries, want 2", len(cache.Entries))
+	}
+	if len(cache.Objects) != 2 {
+		t.Fatalf("cache has %d objects, want 2 (one per imported page, not collided into one)", len(cache.Objects))
+	}
+	for hash, bytes := range cache.Objects {
+		if hash == "" {
+			t.Fatalf("cache contains an object keyed by the zero hash: %s", bytes)
+		}
+	}
+}
+
+// TestDecodeOnlyImporterGetters checks that a worker importer that only
+// ever calls DecodeTemplates - never SetSourceFile/ImportPage, per the
+// cache's whole point of skipping the expensive parse/decode - can safely
+// call the object getters. They used to panic with a nil pointer
+// dereference because they called importer.GetWriter().GetImportedObjects()
+// unconditionally, and a decode-only importer has no writer for its (empty)
+// current source file.
+func TestDecodeOnlyImporterGetters(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (hi) Tj ET"}}, nil)
+
+	producer := NewImporter()
+	if err := producer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := producer.ImportPage(1, "/MediaBox"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := producer.EncodeTemplates(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewImporter()
+	if _, err := worker.DecodeTemplates(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := worker.GetImportedObjects(); len(got) != 0 {
+		t.Fatalf("GetImportedObjects() on a decode-only importer = %+v, want empty (decoded objects are hash-keyed)", got)
+	}
+	// Must not panic even though this importer has no writer; the page in
+	// this fixture has no nested resources to leave hash placeholders for,
+	// so an empty map (not a panic) is the correct result here.
+	_ = worker.GetImportedObjHashPos()
+	objs := worker.GetImportedObjectsUnordered()
+	if len(objs) == 0 {
+		t.Fatalf("GetImportedObjectsUnordered() on a decode-only importer returned nothing, want the decoded objects")
+	}
+}
+
+func TestEncodeTemplatesRestoresWriterHashMode(t *testing.T) {
+	path := buildTestPDF(t, []testPageSpec{{content: "BT (hi) Tj ET"}}, nil)
+
+	importer := NewImporter()
+	if err := importer.SetSourceFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importer.ImportPage(1, "/MediaBox"); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := importer.GetWriter()
+	if writer.UseHash() {
+		t.Fatalf("writer should start in sequential (non-hash) mode")
+	}
+
+	var buf bytes.Buffer
+	if err := importer.EncodeTemplates(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if writer.UseHash() {
+		t.Fatalf("EncodeTemplates left the writer permanently in hashed mode; it should restore the prior mode")
+	}
+
+	tplNames, err := importer.PutFormXobjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, id := range tplNames {
+		if id == 0 {
+			t.Fatalf("PutFormXobjects() after EncodeTemplates assigned id 0 for %s, want a real sequential id", name)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package gofpdi
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// pdfObjectId identifies an object PdfWriter has copied from a source PDF,
+// either by the sequential integer id assigned in "ordered" mode or by the
+// sha1 content hash assigned in "unordered" (hashed) mode. Exactly one of
+// the two fields is meaningful, depending on PdfWriter.useHash.
+type pdfObjectId struct {
+	id   int
+	hash string
+}
+
+// writerTemplate is one page PdfWriter.ImportPage has captured, pending
+// serialization into a Form XObject by PutFormXobjects.
+type writerTemplate struct {
+	pageno                 int
+	resources              pdfDict
+	content                []byte
+	boxX, boxY, boxW, boxH float64
+
+	emitted bool
+	objID   pdfObjectId
+}
+
+// hashPlaceholder records the byte offset of a child object's hash inside
+// its parent's serialized bytes, so the pdf generator library can later
+// substitute the child's final object id once it is known.
+type hashPlaceholder struct {
+	offset int
+	hash   string
+}
+
+// PdfWriter copies pages (and whatever they reference) out of a PdfReader
+// as self-contained Form XObjects. It never writes a PDF file of its own;
+// "writing" here means producing object bytes for a generator library to
+// embed in its own output document.
+//
+// A PdfWriter is safe for concurrent use: mu guards every field below, so
+// e.g. ImportPage and PutFormXobjects can be called from different
+// goroutines (by an Importer juggling several source files) without racing
+// on templates/importedObjects/refCache.
+type PdfWriter struct {
+	mu sync.Mutex
+
+	outFile string
+
+	useHash      bool
+	nextObjectID int
+	tplIdOffset  int
+
+	templates []*writerTemplate
+
+	importedObjects map[pdfObjectId][]byte
+	importedHashPos map[pdfObjectId]map[int]string
+
+	// refCache dedupes objects already copied from a given source
+	// reference within this writer, and emitting guards against cycles.
+	refCache map[pdfRef]pdfObjectId
+	emitting map[pdfRef]bool
+}
+
+// NewPdfWriter creates a PdfWriter. outFile is accepted for API
+// compatibility with callers that name an output file, but this writer
+// never writes to disk itself - it only hands object bytes back to the
+// caller's PDF generator.
+func NewPdfWriter(outFile string) (*PdfWriter, error) {
+	return &PdfWriter{
+		outFile:         outFile,
+		nextObjectID:    1,
+		importedObjects: make(map[pdfObjectId][]byte),
+		importedHashPos: make(map[pdfObjectId]map[int]string),
+		refCache:        make(map[pdfRef]pdfObjectId),
+		emitting:        make(map[pdfRef]bool),
+	}, nil
+}
+
+// SetTplIdOffset offsets the /GOFPDITPLn numbering this writer hands out,
+// so templates from several writers sharing one Importer don't collide.
+func (w *PdfWriter) SetTplIdOffset(offset int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tplIdOffset = offset
+}
+
+// SetUseHash switches between sequential integer object ids (the default)
+// and content-hash ids.
+func (w *PdfWriter) SetUseHash(use bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.useHash = use
+}
+
+// UseHash reports whether this writer is currently assigning content-hash
+// object ids (true) or sequential integer ids (false).
+func (w *PdfWriter) UseHash() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.useHash
+}
+
+// SetNextObjectID sets the next sequential object id this writer will
+// hand out in non-hashed mode.
+func (w *PdfWriter) SetNextObjectID(id int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextObjectID = id
+}
+
+// ImportPage captures pageno's content stream, resources and box from
+// reader for later emission by PutFormXobjects/PutFormXobjectsUnordered,
+// and returns a template id local to this writer.
+func (w *PdfWriter) ImportPage(reader *PdfReader, pageno int, box string) (int, error) {
+	// The page content/box lookup only touches reader, which guards its
+	// own state (objCache) internally, so it runs without w.mu held -
+	// letting two goroutines importing from two different source files
+	// (and therefore two different readers/writers) make progress at the
+	// same time instead of serializing on this writer's lock.
+	content, resources, err := reader.getPageContent(pageno)
+	if err != nil {
+		return 0, err
+	}
+
+	x, y, bw, bh, err := reader.boxRect(reader.pages[pageno-1], box, 1.0)
+	if err != nil {
+		return 0, err
+	}
+
+	tpl := &writerTemplate{
+		pageno:    pageno,
+		resources: resources,
+		content:   content,
+		boxX:      x,
+		boxY:      y,
+		boxW:      bw,
+		boxH:      bh,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.templates = append(w.templates, tpl)
+	return len(w.templates) - 1, nil
+}
+
+// PutFormXobjects serializes every template imported so far that hasn't
+// already been emitted, and returns a map of template names (e.g.
+// "/GOFPDITPL1") to the object id assigned to each.
+func (w *PdfWriter) PutFormXobjects(reader *PdfReader) (map[string]pdfObjectId, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make(map[string]pdfObjectId, len(w.templates))
+
+	for idx, tpl := range w.templates {
+		if !tpl.emitted {
+			objID, err := w.emitFormXObject(reader, tpl)
+			if err != nil {
+				return nil, err
+			}
+			tpl.objID = objID
+			tpl.emitted = true
+		}
+
+		name := fmt.Sprintf("/GOFPDITPL%d", idx+w.tplIdOffset)
+		res[name] = tpl.objID
+	}
+
+	return res, nil
+}
+
+// emitAllHashed returns every one of this writer's templates as a Form
+// XObject addressed purely by content hash, regardless of whether
+// PutFormXobjects has already emitted some of them under sequential
+// integer ids. EncodeTemplates needs this: a cache keyed by sequential id
+// isn't portable across processes, but re-emitting into w's own
+// importedObjects/importedHashPos under hash mode would collide with (and
+// overwrite) any int-keyed entries already there, since the zero hash ""
+// is shared by every int-mode pdfObjectId.
+//
+// To avoid that, templates are replayed through a disposable PdfWriter that
+// shares no state with w, so w's own id assignments and import maps are
+// left untouched.
+func (w *PdfWriter) emitAllHashed(reader *PdfReader) (map[pdfObjectId][]byte, map[pdfObjectId]map[int]string, error) {
+	w.mu.Lock()
+	templates := make([]*writerTemplate, len(w.templates))
+	for i, tpl := range w.templates {
+		templates[i] = &writerTemplate{
+			pageno:    tpl.pageno,
+			resources: tpl.resources,
+			content:   tpl.content,
+			boxX:      tpl.boxX,
+			boxY:      tpl.boxY,
+			boxW:      tpl.boxW,
+			boxH:      tpl.boxH,
+		}
+	}
+	tplIdOffset := w.tplIdOffset
+	w.mu.Unlock()
+
+	shadow, err := NewPdfWriter("")
+	if err != nil {
+		return nil, nil, err
+	}
+	shadow.SetUseHash(true)
+	shadow.SetTplIdOffset(tplIdOffset)
+	shadow.templates = templates
+
+	if _, err := shadow.PutFormXobjects(reader); err != nil {
+		return nil, nil, err
+	}
+
+	return shadow.GetImportedObjects(), shadow.GetImportedObjHashPos(), nil
+}
+
+func (w *PdfWriter) emitFormXObject(reader *PdfReader, tpl *writerTemplate) (pdfObjectId, error) {
+	resources := tpl.resources
+	if resources == nil {
+		resources = pdfDict{}
+	}
+
+	dict := pdfDict{
+		"Type":      pdfName("XObject"),
+		"Subtype":   pdfName("Form"),
+		"FormType":  float64(1),
+		"BBox":      pdfArray{float64(0), float64(0), tpl.boxW, tpl.boxH},
+		"Matrix":    pdfArray{float64(1), float64(0), float64(0), float64(1), -tpl.boxX, -tpl.boxY},
+		"Resources": resources,
+	}
+
+	return w.emitObject(reader, dict, tpl.content)
+}
+
+// emitObject serializes dict (recursively copying any referenced stream
+// objects it points to, and inlining any other referenced values) and
+// appends data as the object's stream body, then registers the result
+// under a newly assigned object id (sequential or hash, per SetUseHash).
+func (w *PdfWriter) emitObject(reader *PdfReader, dict pdfDict, data []byte) (pdfObjectId, error) {
+	var dictBuf bytes.Buffer
+	var hashPositions []hashPlaceholder
+
+	if err := w.serializeValue(reader, dict, &dictBuf, &hashPositions); err != nil {
+		return pdfObjectId{}, err
+	}
+
+	var full bytes.Buffer
+	full.Write(dictBuf.Bytes())
+	full.WriteString("\nstream\n")
+	full.Write(data)
+	full.WriteString("\nendstream")
+
+	var objID pdfObjectId
+	if w.useHash {
+		sum := sha1.Sum(full.Bytes())
+		objID = pdfObjectId{hash: hex.EncodeToString(sum[:])}
+	} else {
+		objID = pdfObjectId{id: w.nextObjectID}
+		w.nextObjectID++
+	}
+
+	w.importedObjects[objID] = full.Bytes()
+
+	if w.useHash && len(hashPositions) > 0 {
+		posMap := make(map[int]string, len(hashPositions))
+		for _, hp := range hashPositions {
+			posMap[hp.offset] = hp.hash
+		}
+		w.importedHashPos[objID] = posMap
+	}
+
+	return objID, nil
+}
+
+// serializeValue writes v's PDF syntax representation to out. Indirect
+// references to stream objects become their own emitted objects (copied
+// recursively); references to anything else are inlined at the point of
+// reference.
+func (w *PdfWriter) serializeValue(reader *PdfReader, v interface{}, out *bytes.Buffer, hashPositions *[]hashPlaceholder) error {
+	switch t := v.(type) {
+	case nil:
+		out.WriteString("null")
+	case bool:
+		if t {
+			out.WriteString("true")
+		} else {
+			out.WriteString("false")
+		}
+	case float64:
+		out.WriteString(formatPdfNumber(t))
+	case pdfName:
+		out.WriteString("/" + string(t))
+	case string:
+		out.WriteString(escapePdfLiteralString(t))
+	case pdfArray:
+		out.WriteString("[")
+		for i, e := range t {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			if err := w.serializeValue(reader, e, out, hashPositions); err != nil {
+				return err
+			}
+		}
+		out.WriteString("]")
+	case pdfDict:
+		out.WriteString("<<")
+		for k, val := range t {
+			out.WriteString("/" + k + " ")
+			if err := w.serializeValue(reader, val, out, hashPositions); err != nil {
+				return err
+			}
+			out.WriteString(" ")
+		}
+		out.WriteString(">>")
+	case pdfRef:
+		return w.serializeRef(reader, t, out, hashPositions)
+	case *pdfStream:
+		objID, err := w.emitObject(reader, t.Dict, t.Data)
+		if err != nil {
+			return err
+		}
+		w.writeObjRef(objID, out, hashPositions)
+	default:
+		return fmt.Errorf("gofpdi: cannot serialize value of type %T", v)
+	}
+	return nil
+}
+
+func (w *PdfWriter) serializeRef(reader *PdfReader, ref pdfRef, out *bytes.Buffer, hashPositions *[]hashPlaceholder) error {
+	if cached, ok := w.refCache[ref]; ok {
+		w.writeObjRef(cached, out, hashPositions)
+		return nil
+	}
+	if w.emitting[ref] {
+		return fmt.Errorf("gofpdi: cyclic object reference at %d %d R", ref.Num, ref.Gen)
+	}
+
+	target, err := reader.getObject(ref.Num)
+	if err != nil {
+		return err
+	}
+
+	stream, ok := target.(*pdfStream)
+	if !ok {
+		// Non-stream values are inlined directly at the point of
+		// reference rather than becoming their own object.
+		return w.serializeValue(reader, target, out, hashPositions)
+	}
+
+	w.emitting[ref] = true
+	objID, err := w.emitObject(reader, stream.Dict, stream.Data)
+	delete(w.emitting, ref)
+	if err != nil {
+		return err
+	}
+
+	w.refCache[ref] = objID
+	w.writeObjRef(objID, out, hashPositions)
+	return nil
+}
+
+func (w *PdfWriter) writeObjRef(objID pdfObjectId, out *bytes.Buffer, hashPositions *[]hashPlaceholder) {
+	if w.useHash {
+		*hashPositions = append(*hashPositions, hashPlaceholder{offset: out.Len(), hash: objID.hash})
+		out.WriteString(objID.hash)
+		return
+	}
+	out.WriteString(strconv.Itoa(objID.id))
+	out.WriteString(" 0 R")
+}
+
+// GetImportedObjects returns every object this writer has emitted so far,
+// keyed by the id or hash PutFormXobjects/PutFormXobjectsUnordered
+// assigned it.
+func (w *PdfWriter) GetImportedObjects() map[pdfObjectId][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make(map[pdfObjectId][]byte, len(w.importedObjects))
+	for k, v := range w.importedObjects {
+		res[k] = v
+	}
+	return res
+}
+
+// GetImportedObjHashPos returns, for each hash-identified object, the byte
+// offsets within it where a referenced child object's hash placeholder
+// needs to be replaced with that child's final object id.
+func (w *PdfWriter) GetImportedObjHashPos() map[pdfObjectId]map[int]string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	res := make(map[pdfObjectId]map[int]string, len(w.importedHashPos))
+	for k, v := range w.importedHashPos {
+		res[k] = v
+	}
+	return res
+}
+
+// UseTemplate returns the template's resource name (e.g. "/GOFPDITPL1")
+// and the x/y/w/h to draw it at, filling in a missing width or height from
+// the source box's aspect ratio.
+func (w *PdfWriter) UseTemplate(templateId int, _x float64, _y float64, _w float64, _h float64) (string, float64, float64, float64, float64) {
+	w.mu.Lock()
+	name := fmt.Sprintf("/GOFPDITPL%d", templateId+w.tplIdOffset)
+
+	var boxW, boxH float64
+	if templateId >= 0 && templateId < len(w.templates) {
+		boxW, boxH = w.templates[templateId].boxW, w.templates[templateId].boxH
+	}
+	w.mu.Unlock()
+
+	x, y, wd, h := scaleTemplateBox(boxW, boxH, _x, _y, _w, _h)
+	return name, x, y, wd, h
+}
+
+func formatPdfNumber(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimRight(s, ".")
+		if s == "" || s == "-" {
+			s += "0"
+		}
+	}
+	return s
+}
+
+func escapePdfLiteralString(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('(')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(', ')', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte(')')
+	return out.String()
+}